@@ -2,9 +2,11 @@
 //
 // It uses the github.com/cenkalti/backoff algorithm.
 //
-// Network failures and HTTP 5xx status codes qualify for retries.
+// Network failures and HTTP 5xx status codes qualify for retries. HTTP 429
+// (Too Many Requests) also qualifies for retries, and honors the
+// Retry-After response header (see below).
 //
-// HTTP calls that return HTTP 4xx status codes do not get retried.
+// HTTP calls that return other HTTP 4xx status codes do not get retried.
 //
 // If the last HTTP request made does not result in a 2xx HTTP status code, an
 // error is returned, together with the data.
@@ -12,12 +14,62 @@
 // There are several utility methods that wrap the standard net/http package
 // calls.
 //
-// Any function that takes no arguments and returns (*http.Response, error) can
-// be retried using this library's Retry function.
+// Any function that takes no arguments and returns (*http.Response, error,
+// error) can be retried using this library's Retry function.
 //
 // The methods in this library should be able to run concurrently in multiple
 // go routines.
 //
+// Context support
+//
+// Every retrying method has a *Context variant (e.g. GetContext alongside
+// Get) that accepts a context.Context as its first argument. Cancelling the
+// context aborts an in-progress backoff sleep promptly, returning
+// ctx.Err() instead of waiting for the next attempt. The non-Context
+// variants are equivalent to passing context.Background().
+//
+// Retry-After
+//
+// When a retried response is HTTP 429 or 503 and carries a Retry-After
+// header, that header is parsed (as either an HTTP-date or a number of
+// delta-seconds, per RFC 7231 section 7.1.3) and used as the wait before the
+// next attempt, in place of the exponential value, capped at
+// BackOffSettings.MaxInterval.
+//
+// Retry policies
+//
+// Client.Policy controls which errors and status codes are retried, and can
+// veto retries based on the request method; see RetryPolicy,
+// DefaultRetryPolicy, ConservativeRetryPolicy and AggressiveRetryPolicy.
+//
+// Circuit breaker
+//
+// Client.Breaker, if set, prevents Retry from hammering a host that is
+// already failing most of its requests: once FailureThreshold of the
+// requests to a host within SamplingWindow have failed, the breaker opens
+// for that host and further requests fail fast with BreakerOpenError for
+// OpenDuration, rather than running a full retry loop against a downed
+// backend. See Breaker.
+//
+// Observability
+//
+// Client.OnRetry and Client.OnGiveUp are called around each retry and on
+// final failure respectively; OnRetry defaults to the log line RetryContext
+// has always printed, so leaving it unset is backward compatible.
+// Client.Logger additionally receives a ResponseLog for every attempt, with
+// per-attempt timing, for wiring into Prometheus, OpenTelemetry or a
+// structured logger; see ResponseLog.Dump for when the raw response is
+// included.
+//
+// http.RoundTripper
+//
+// Client.Transport wraps an existing http.RoundTripper (e.g.
+// http.DefaultTransport) with the same retry logic as Retry, so that any
+// code using an *http.Client - an SDK, a generated client, resty - gets
+// backoff without changing a single call site:
+//
+//  http.DefaultClient.Transport = httpbackoff.New().Transport(http.DefaultTransport, nil)
+//
 // Example Usage
 //
 // Consider this trivial HTTP GET request:
@@ -34,22 +86,452 @@ package httpbackoff
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/cenkalti/backoff"
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Client holds the exponential backoff configuration used to retry HTTP
+// requests. The zero value is not ready to use; call New() to obtain a
+// Client with sensible defaults.
+type Client struct {
+	BackOffSettings *backoff.ExponentialBackOff
+
+	// Policy decides whether a given attempt should be retried. If nil,
+	// DefaultRetryPolicy is used.
+	Policy RetryPolicy
+
+	// Breaker, if non-nil, wraps every URL-aware retry method (Get, Post,
+	// ClientDo, etc.) with a per-host circuit breaker: see Breaker. It is
+	// not consulted by Retry/RetryContext directly, since those have no
+	// host to key off without a request having been made yet.
+	Breaker *Breaker
+
+	// OnRetry, if non-nil, is called after each failed attempt, once
+	// Policy has decided to retry and the wait duration for the next
+	// attempt is known, in place of RetryContext's default log line. resp
+	// is nil if the attempt failed with a network error rather than
+	// completing an HTTP round-trip, in which case req is also nil.
+	OnRetry func(attempt int, wait time.Duration, req *http.Request, resp *http.Response, err error)
+
+	// OnGiveUp, if non-nil, is called once RetryContext returns a non-nil
+	// error: Policy declined a further retry, BackOffSettings'
+	// MaxElapsedTime was reached, or ctx was cancelled.
+	OnGiveUp func(attempts int, lastErr error)
+
+	// Logger, if non-nil, receives a RequestLog/ResponseLog pair for
+	// every attempt RetryContext makes, with per-attempt timing, so
+	// callers can wire the module into Prometheus, OpenTelemetry or their
+	// own structured logger. See ResponseLog.Dump for when the raw
+	// response is included.
+	Logger Logger
+}
+
+// New returns a Client configured with the default exponential backoff
+// settings from github.com/cenkalti/backoff, using DefaultRetryPolicy.
+func New() *Client {
+	return &Client{
+		BackOffSettings: backoff.NewExponentialBackOff(),
+	}
+}
+
+// ExponentialBackOff is the old name of Client, kept as an alias so that
+// existing code declaring variables as *ExponentialBackOff (e.g.
+// `var c *httpbackoff.ExponentialBackOff`) keeps compiling. The old type
+// was literally backoff.ExponentialBackOff, so code that set its fields
+// directly (e.g. `c.MaxInterval = ...`) needs to go through
+// BackOffSettings instead (`c.BackOffSettings.MaxInterval = ...`).
+type ExponentialBackOff = Client
+
+// policy returns client.Policy, falling back to DefaultRetryPolicy.
+func (client *Client) policy() RetryPolicy {
+	if client.Policy != nil {
+		return client.Policy
+	}
+	return DefaultRetryPolicy
+}
+
+// onRetry returns client.OnRetry, falling back to a function that
+// reproduces RetryContext's historical log.Printf("Error: %s", err) line,
+// so that leaving OnRetry unset is backward compatible.
+func (client *Client) onRetry() func(attempt int, wait time.Duration, req *http.Request, resp *http.Response, err error) {
+	if client.OnRetry != nil {
+		return client.OnRetry
+	}
+	return func(attempt int, wait time.Duration, req *http.Request, resp *http.Response, err error) {
+		log.Printf("Error: %s", err)
+	}
+}
+
+// logger returns client.Logger, falling back to DiscardLogger.
+func (client *Client) logger() Logger {
+	if client.Logger != nil {
+		return client.Logger
+	}
+	return DiscardLogger
+}
+
+// RequestLog summarizes the request made for one attempt, as reported to a
+// Logger. It is the zero value if no response was received at all, e.g. on
+// a network error.
+type RequestLog struct {
+	Method string
+	URL    string
+}
+
+// ResponseLog is passed to Client.Logger after every attempt RetryContext
+// makes, whether it succeeded or failed.
+type ResponseLog struct {
+	// Attempt is the number of this attempt, starting at 1.
+	Attempt int
+
+	Request RequestLog
+
+	// StatusCode is the HTTP status code received, or 0 if Err is a
+	// network-level error and no response was received.
+	StatusCode int
+
+	// Err is the error Retry associates with this attempt: the network
+	// error, or the BadHttpResponseCode synthesized for a non-2xx
+	// response. It is nil for a successful (2xx) attempt.
+	Err error
+
+	// Duration is how long this attempt's httpCall took to return.
+	Duration time.Duration
+
+	// Dump is the raw HTTP/1.1 wire representation of the response,
+	// produced by httputil.DumpResponse. It is only populated when
+	// Client.Logger is set to something other than DiscardLogger, since
+	// dumping is too expensive to do unconditionally.
+	Dump []byte
+}
+
+// Logger receives a structured ResponseLog entry for every attempt
+// RetryContext makes. Implementations must return promptly, since
+// RetryContext calls Logger synchronously between attempts.
+type Logger interface {
+	LogResponse(ResponseLog)
+}
+
+// LoggerFunc adapts an ordinary function to a Logger.
+type LoggerFunc func(ResponseLog)
+
+// LogResponse calls f.
+func (f LoggerFunc) LogResponse(r ResponseLog) {
+	f(r)
+}
+
+// discardLogger is a Logger that drops every entry.
+type discardLogger struct{}
+
+func (discardLogger) LogResponse(ResponseLog) {}
+
+// DiscardLogger is the default Logger: it drops every entry. Retry and
+// RetryContext use this when Client.Logger is nil.
+var DiscardLogger Logger = discardLogger{}
+
+// RetryPolicy decides, after a completed attempt, whether Retry should try
+// again, and optionally how long to wait before doing so. It is modeled on
+// go-retryablehttp's CheckRetry and the ACME client's RetryBackoff field.
+//
+// resp and err mirror the tempError/permError resolution already performed
+// by Retry: resp is non-nil on any completed HTTP round-trip (in which case
+// resp.Request gives access to the original request, e.g. to key a decision
+// off its method), and err is the BadHttpResponseCode synthesized for a
+// non-2xx resp, or the network error when resp is nil. attempt is the
+// number of the attempt that just completed (starting at 1).
+//
+// When retry is true, wait is the base wait duration to use before the next
+// attempt; a wait <= 0 leaves Retry's exponential backoff value (and any
+// Retry-After override) untouched.
+type RetryPolicy interface {
+	ShouldRetry(resp *http.Response, err error, attempt int) (retry bool, wait time.Duration)
+}
+
+// RetryPolicyFunc adapts an ordinary function to a RetryPolicy, in the
+// manner of http.HandlerFunc.
+type RetryPolicyFunc func(resp *http.Response, err error, attempt int) (bool, time.Duration)
+
+// ShouldRetry calls f.
+func (f RetryPolicyFunc) ShouldRetry(resp *http.Response, err error, attempt int) (bool, time.Duration) {
+	return f(resp, err, attempt)
+}
+
+// idempotentMethods are the HTTP methods considered safe to retry without
+// any additional guarantee from the caller, per RFC 7231 section 4.2.2.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+	http.MethodTrace:   true,
+}
+
+// statusCodePolicy is a RetryPolicy built from a base set of retryable
+// status codes (5xx and 429) plus an extra set, and an optional predicate
+// that vetoes retries based on the request method.
+type statusCodePolicy struct {
+	extra       map[int]bool
+	allowMethod func(method string) bool
+}
+
+// newStatusCodePolicy returns a statusCodePolicy retrying 5xx and 429
+// responses, any network error, and the given extra status codes.
+// allowMethod may be nil, meaning no method is vetoed.
+func newStatusCodePolicy(extraStatusCodes []int, allowMethod func(method string) bool) *statusCodePolicy {
+	extra := make(map[int]bool, len(extraStatusCodes))
+	for _, code := range extraStatusCodes {
+		extra[code] = true
+	}
+	return &statusCodePolicy{extra: extra, allowMethod: allowMethod}
+}
+
+func (p *statusCodePolicy) ShouldRetry(resp *http.Response, err error, attempt int) (bool, time.Duration) {
+	if resp == nil {
+		// A network-level error; we have no request to veto against, so
+		// err != nil is always retryable, and nil err (shouldn't happen
+		// here) is not.
+		if p.allowMethod != nil {
+			return false, 0
+		}
+		return err != nil, 0
+	}
+	if p.allowMethod != nil && resp.Request != nil && !p.allowMethod(resp.Request.Method) {
+		return false, 0
+	}
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return true, 0
+	}
+	return p.extra[resp.StatusCode], 0
+}
+
+// DefaultRetryPolicy retries network errors and HTTP 5xx/429 responses
+// regardless of request method, matching Retry's historical behavior.
+// Retry and RetryContext use this policy when Client.Policy is nil.
+var DefaultRetryPolicy RetryPolicy = newStatusCodePolicy(nil, nil)
+
+// ConservativeRetryPolicy only retries idempotent methods (GET, HEAD,
+// OPTIONS, PUT, DELETE, TRACE). POST, PATCH and CONNECT requests are never
+// retried, even on a network error or a 5xx/429 response, and a network
+// error for which the method can't be determined is treated as
+// non-retryable.
+var ConservativeRetryPolicy RetryPolicy = newStatusCodePolicy(nil, func(method string) bool {
+	return idempotentMethods[method]
+})
+
+// NewRetryPolicy returns a RetryPolicy equivalent to DefaultRetryPolicy,
+// additionally retrying the given HTTP status codes, e.g.
+// NewRetryPolicy(http.StatusRequestTimeout, 425) to also retry 408 and 425.
+func NewRetryPolicy(retryableStatusCodes ...int) RetryPolicy {
+	return newStatusCodePolicy(retryableStatusCodes, nil)
+}
+
+// aggressiveRetryPolicy retries everything DefaultRetryPolicy does, and
+// additionally retries POST requests that carry an Idempotency-Key header
+// against HTTP 409 Conflict, on the assumption that the server deduplicates
+// by that key, so retrying cannot duplicate the original side effect.
+type aggressiveRetryPolicy struct{}
+
+func (aggressiveRetryPolicy) ShouldRetry(resp *http.Response, err error, attempt int) (bool, time.Duration) {
+	if resp != nil && resp.StatusCode == http.StatusConflict && resp.Request != nil &&
+		resp.Request.Method == http.MethodPost && resp.Request.Header.Get("Idempotency-Key") != "" {
+		return true, 0
+	}
+	return DefaultRetryPolicy.ShouldRetry(resp, err, attempt)
+}
+
+// AggressiveRetryPolicy is documented on aggressiveRetryPolicy.
+var AggressiveRetryPolicy RetryPolicy = aggressiveRetryPolicy{}
+
+// State is the state of a Breaker for a given host.
+type State int
+
+const (
+	// StateClosed is the normal state: requests are attempted and their
+	// outcome is tracked.
+	StateClosed State = iota
+	// StateOpen means recent requests to the host have failed too often;
+	// requests fail fast with BreakerOpenError without being attempted.
+	StateOpen
+	// StateHalfOpen means OpenDuration has elapsed since the breaker
+	// opened, and a single probe request is being allowed through to
+	// decide whether to close the breaker again or reopen it.
+	StateHalfOpen
 )
 
-type ExponentialBackOff backoff.ExponentialBackOff
+// String returns a lower-case name for s, e.g. "open".
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker is a per-host circuit breaker that can be attached to a Client via
+// Client.Breaker, so that Retry does not keep hammering a host that is
+// already failing most of its requests.
+//
+// While the breaker is closed for a host, Breaker records the outcome of
+// every completed Retry call to that host, counting only a genuine
+// exhausted-retry failure (the RetryPolicy judged the error retryable, but
+// backoff ran out) against it; a permanent error or a RetryPolicy-declined
+// retry (e.g. a clean 4xx) is the caller's fault, not the host's, and counts
+// as a success. Once the fraction of failures within the trailing
+// SamplingWindow reaches FailureThreshold, the breaker
+// opens for that host: further requests fail fast with BreakerOpenError,
+// without running a retry loop at all, for OpenDuration. After OpenDuration
+// elapses, the breaker allows a single half-open probe request through;
+// success closes it again, failure reopens it for another OpenDuration.
+//
+// A Breaker must not be copied after first use.
+type Breaker struct {
+	// FailureThreshold is the fraction, in (0, 1], of requests to a host
+	// within SamplingWindow that must have failed for the breaker to
+	// open for that host.
+	FailureThreshold float64
+
+	// SamplingWindow is how far back completed requests are considered
+	// when computing a host's failure fraction.
+	SamplingWindow time.Duration
+
+	// OpenDuration is how long the breaker stays open for a host, failing
+	// requests fast, before allowing a half-open probe through.
+	OpenDuration time.Duration
+
+	// OnStateChange, if non-nil, is called whenever a host's breaker
+	// transitions from one State to another. It must return promptly, as
+	// it is called while Breaker's internal lock is held.
+	OnStateChange func(host string, from, to State)
+
+	mu    sync.Mutex
+	hosts map[string]*hostBreaker
+}
 
-func New() *ExponentialBackOff {
-	x := ExponentialBackOff(*backoff.NewExponentialBackOff())
-	return &x
+// hostBreaker is the per-host state tracked by a Breaker.
+type hostBreaker struct {
+	state    State
+	openedAt time.Time
+	events   []breakerEvent
+}
+
+// breakerEvent records the outcome of one completed Retry call, for
+// computing a host's failure fraction over Breaker.SamplingWindow.
+type breakerEvent struct {
+	at      time.Time
+	success bool
+}
+
+// BreakerOpenError is returned when Client.Breaker has opened the circuit
+// for a request's host: the request was failed fast, without being
+// attempted.
+type BreakerOpenError struct {
+	Host string
+}
+
+// Error returns an error message naming the host the breaker is open for.
+func (e BreakerOpenError) Error() string {
+	return "httpbackoff: circuit breaker open for host " + e.Host
+}
+
+// host returns (creating if necessary) the hostBreaker for host. Callers
+// must hold b.mu.
+func (b *Breaker) host(host string) *hostBreaker {
+	if b.hosts == nil {
+		b.hosts = make(map[string]*hostBreaker)
+	}
+	hb, ok := b.hosts[host]
+	if !ok {
+		hb = &hostBreaker{}
+		b.hosts[host] = hb
+	}
+	return hb
+}
+
+// transition moves hb to the given state, invoking OnStateChange if the
+// state actually changes. Callers must hold b.mu.
+func (b *Breaker) transition(host string, hb *hostBreaker, to State) {
+	from := hb.state
+	if from == to {
+		return
+	}
+	hb.state = to
+	if to == StateOpen {
+		hb.openedAt = time.Now()
+	}
+	if b.OnStateChange != nil {
+		b.OnStateChange(host, from, to)
+	}
+}
+
+// allow reports whether a request to host may proceed, transitioning an
+// open breaker to half-open once OpenDuration has elapsed.
+func (b *Breaker) allow(host string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hb := b.host(host)
+	if hb.state != StateOpen {
+		return true
+	}
+	if time.Since(hb.openedAt) < b.OpenDuration {
+		return false
+	}
+	b.transition(host, hb, StateHalfOpen)
+	return true
+}
+
+// record reports the outcome of a completed Retry call against host,
+// closing, opening or reopening the breaker as appropriate.
+func (b *Breaker) record(host string, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hb := b.host(host)
+
+	if hb.state == StateHalfOpen {
+		if success {
+			b.transition(host, hb, StateClosed)
+			hb.events = nil
+		} else {
+			b.transition(host, hb, StateOpen)
+		}
+		return
+	}
+
+	now := time.Now()
+	hb.events = append(hb.events, breakerEvent{at: now, success: success})
+	cutoff := now.Add(-b.SamplingWindow)
+	i := 0
+	for i < len(hb.events) && hb.events[i].at.Before(cutoff) {
+		i++
+	}
+	hb.events = hb.events[i:]
+
+	failures := 0
+	for _, e := range hb.events {
+		if !e.success {
+			failures++
+		}
+	}
+	if float64(failures)/float64(len(hb.events)) >= b.FailureThreshold {
+		b.transition(host, hb, StateOpen)
+	}
 }
 
 // Any non 2xx HTTP status code is considered a bad response code, and will
@@ -64,120 +546,448 @@ func (err BadHttpResponseCode) Error() string {
 	return err.Message
 }
 
+// backOff returns a private copy of client.BackOffSettings, so that
+// concurrent calls to Retry/RetryContext do not race on the same
+// ExponentialBackOff's internal state.
+func (client *Client) backOff() *backoff.ExponentialBackOff {
+	settings := *client.BackOffSettings
+	b := &settings
+	b.Reset()
+	return b
+}
+
+// NewRequest builds an *http.Request whose body can be safely replayed
+// across Retry attempts, unlike the request returned by http.NewRequest.
+//
+// body may be nil (no body), []byte, string, io.ReadSeeker, or a
+// body-producing func() (io.ReadCloser, error); any other type results in
+// an error. The request's GetBody field is populated accordingly, so
+// ClientDo, ClientDoContext and the Post family of methods can rewind the
+// body before each retry.
+func NewRequest(method, url string, body interface{}) (*http.Request, error) {
+	return NewRequestWithContext(context.Background(), method, url, body)
+}
+
+// NewRequestWithContext is the context-aware variant of NewRequest.
+func NewRequestWithContext(ctx context.Context, method, url string, body interface{}) (*http.Request, error) {
+	getBody, contentLength, err := bodyFactory(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if getBody != nil {
+		rc, err := getBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = rc
+		req.GetBody = getBody
+		req.ContentLength = contentLength
+	}
+	return req, nil
+}
+
+// bodyFactory turns one of NewRequest's permitted body types into a
+// GetBody-style factory, along with a Content-Length where it is cheaply
+// known (-1 otherwise).
+//
+// A plain io.Reader (e.g. *bytes.Buffer, or an io.Pipe end) is not
+// seekable, so it is read into memory up front and replayed from there on
+// every attempt, the same fallback hashicorp/go-retryablehttp uses for an
+// arbitrary reader. Callers with a body too large to buffer should pass an
+// io.ReadSeeker or a func() (io.ReadCloser, error) instead.
+func bodyFactory(body interface{}) (getBody func() (io.ReadCloser, error), contentLength int64, err error) {
+	switch b := body.(type) {
+	case nil:
+		return nil, 0, nil
+	case []byte:
+		return func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(b)), nil
+		}, int64(len(b)), nil
+	case string:
+		return func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(b)), nil
+		}, int64(len(b)), nil
+	case io.ReadSeeker:
+		return func() (io.ReadCloser, error) {
+			if _, err := b.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			return io.NopCloser(b), nil
+		}, seekerLen(b), nil
+	case func() (io.ReadCloser, error):
+		return b, -1, nil
+	case io.Reader:
+		buf, err := io.ReadAll(b)
+		if c, ok := b.(io.Closer); ok {
+			_ = c.Close()
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(buf)), nil
+		}, int64(len(buf)), nil
+	default:
+		return nil, 0, fmt.Errorf("httpbackoff: unsupported request body type %T", body)
+	}
+}
+
+// seekerLen returns the number of bytes remaining in s, or -1 if that can't
+// be determined without disturbing its position.
+func seekerLen(s io.ReadSeeker) int64 {
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	if _, err := s.Seek(cur, io.SeekStart); err != nil {
+		return -1
+	}
+	return end - cur
+}
+
+// rewindRequest prepares req for a retry attempt after attempt (the number
+// of the attempt just completed): it closes the previous body, if any, and
+// replaces it with a fresh one from req.GetBody. It is a no-op for
+// requests without a body. It errors if req has a body that can't be
+// replayed, e.g. a plain io.Reader passed directly to an *http.Request
+// rather than built via NewRequest.
+func rewindRequest(req *http.Request, attempt int) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if attempt == 0 {
+		return nil
+	}
+	_ = req.Body.Close()
+	if req.GetBody == nil {
+		return fmt.Errorf("httpbackoff: cannot retry %s %s: request body is not replayable (build it with httpbackoff.NewRequest)", req.Method, req.URL)
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = rc
+	return nil
+}
+
+// retryAfter parses the Retry-After header on resp, per RFC 7231 section
+// 7.1.3, which permits either a number of delta-seconds, or an HTTP-date.
+// The second return value reports whether a valid value was found.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if wait := time.Until(t); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
 // Retry is the core library method for retrying http calls.
 //
 // httpCall should be a function that performs the http operation, and returns
-// (resp *http.Response, tempError error, permError error). Errors that should
-// cause retries should be returned as tempError. Permanent errors that should
-// not result in retries should be returned as permError. Retries are performed
-// using the exponential backoff algorithm from the github.com/cenkalti/backoff
-// package. Retry automatically treats HTTP 5xx status codes as a temporary
-// error, and any other non-2xx HTTP status codes as a permanent error. Thus
-// httpCall function does not need to handle the HTTP status code of resp,
-// since Retry will take care of it.
+// (resp *http.Response, tempError error, permError error). Permanent errors
+// that should not result in retries should be returned as permError; these
+// bypass Policy entirely. Otherwise, Retry synthesizes a BadHttpResponseCode
+// for any non-2xx resp, and consults client.Policy (DefaultRetryPolicy if
+// nil) with that error, or with tempError directly when httpCall returned
+// one, to decide whether to retry. Thus httpCall does not need to handle the
+// HTTP status code of resp itself, since Retry takes care of it.
 //
 // Concurrent use of this library method is supported.
-func (backOffSettings *ExponentialBackOff) Retry(httpCall func() (resp *http.Response, tempError error, permError error)) (*http.Response, int, error) {
-	var tempError, permError error
+func (client *Client) Retry(httpCall func() (resp *http.Response, tempError error, permError error)) (*http.Response, int, error) {
+	return client.RetryContext(context.Background(), httpCall)
+}
+
+// RetryContext is identical to Retry, except that the supplied context can be
+// used to abort an in-progress backoff wait, e.g. when the caller no longer
+// needs the result. If ctx is cancelled between attempts, RetryContext
+// returns immediately with ctx.Err().
+func (client *Client) RetryContext(ctx context.Context, httpCall func() (resp *http.Response, tempError error, permError error)) (*http.Response, int, error) {
+	resp, attempts, err, _ := client.retryContext(ctx, httpCall)
+	return resp, attempts, err
+}
+
+// retryContext does the work of RetryContext, additionally reporting whether
+// the final error (if any) represents a retryable failure that was retried
+// until the backoff policy gave up, as opposed to a permError or a
+// RetryPolicy-declined-to-retry outcome (e.g. a clean 4xx, or a non-idempotent
+// method under ConservativeRetryPolicy). retryWithBreaker uses this to avoid
+// tripping Client.Breaker on errors that are not the host's fault.
+func (client *Client) retryContext(ctx context.Context, httpCall func() (resp *http.Response, tempError error, permError error)) (*http.Response, int, error, bool) {
 	var response *http.Response
+	var callError error
 	attempts := 0
-	doHttpCall := func() error {
+
+	b := client.backOff()
+	policy := client.policy()
+	onRetry := client.onRetry()
+	logger := client.logger()
+
+	giveUp := func(attempts int, err error, retryableFailure bool) (*http.Response, int, error, bool) {
+		if client.OnGiveUp != nil {
+			client.OnGiveUp(attempts, err)
+		}
+		return response, attempts, err, retryableFailure
+	}
+
+	for {
+		var tempError, permError error
+		started := time.Now()
 		response, tempError, permError = httpCall()
-		attempts += 1
-		if tempError != nil {
-			return tempError
+		duration := time.Since(started)
+		attempts++
+
+		logEntry := ResponseLog{Attempt: attempts, Duration: duration}
+		if response != nil {
+			logEntry.StatusCode = response.StatusCode
+			if response.Request != nil {
+				logEntry.Request = RequestLog{Method: response.Request.Method, URL: response.Request.URL.String()}
+			}
+			// See ResponseLog.Dump: populated for every attempt, not just
+			// failing ones, but only when a Logger is registered.
+			if logger != DiscardLogger {
+				logEntry.Dump, _ = httputil.DumpResponse(response, true)
+			}
 		}
+
 		if permError != nil {
-			return nil
-		}
-		// this is a no-op
-		raw, readErr := httputil.DumpResponse(response, true)
-		out := ""
-		if readErr == nil {
-			out = string(raw)
-		}
-		// now check if http response code is such that we should retry [500, 600)...
-		if respCode := response.StatusCode; respCode/100 == 5 {
-			return BadHttpResponseCode{
-				HttpResponseCode: respCode,
-				Message:          "(Intermittent) HTTP response code " + strconv.Itoa(respCode) + "\n" + out,
+			logEntry.Err = permError
+			logger.LogResponse(logEntry)
+			return giveUp(attempts, permError, false)
+		}
+
+		switch {
+		case tempError != nil:
+			callError = tempError
+		case response.StatusCode/100 == 2:
+			logger.LogResponse(logEntry)
+			return response, attempts, nil, false
+		default:
+			callError = BadHttpResponseCode{
+				HttpResponseCode: response.StatusCode,
+				Message:          "HTTP response code " + strconv.Itoa(response.StatusCode),
 			}
 		}
-		// now check http response code is ok [200, 300)...
-		if respCode := response.StatusCode; respCode/100 != 2 {
-			permError = BadHttpResponseCode{
-				HttpResponseCode: respCode,
-				Message:          "(Permanent) HTTP response code " + strconv.Itoa(respCode) + "\n" + out,
+		logEntry.Err = callError
+		logger.LogResponse(logEntry)
+
+		retry, policyWait := policy.ShouldRetry(response, callError, attempts)
+		if !retry {
+			return giveUp(attempts, callError, false)
+		}
+
+		// This response is about to be discarded in favour of a retry;
+		// drain and close its body so the underlying connection can be
+		// reused, rather than leaking it.
+		if response != nil && response.Body != nil {
+			_, _ = io.Copy(io.Discard, response.Body)
+			_ = response.Body.Close()
+		}
+
+		wait := b.NextBackOff()
+		if wait == b.Stop {
+			// The policy judged callError retryable but the backoff
+			// budget ran out: this is a genuine exhausted-retry failure
+			// against the host, unlike the giveUp calls above.
+			return giveUp(attempts, callError, true)
+		}
+		if policyWait > 0 {
+			wait = policyWait
+		}
+
+		// Honor Retry-After on 429/503, overriding the exponential (or
+		// policy-supplied) wait for this attempt only, capped at
+		// MaxInterval to protect against hostile/misbehaving servers.
+		if response != nil && (response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable) {
+			if ra, ok := retryAfter(response); ok {
+				wait = ra
+				if b.MaxInterval > 0 && wait > b.MaxInterval {
+					wait = b.MaxInterval
+				}
 			}
-			return nil
 		}
-		return nil
+
+		var req *http.Request
+		if response != nil {
+			req = response.Request
+		}
+		onRetry(attempts, wait, req, response, callError)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return giveUp(attempts, ctx.Err(), false)
+		case <-timer.C:
+		}
 	}
+}
 
-	// Make HTTP API calls using an exponential backoff algorithm...
-	b := backoff.ExponentialBackOff(*backOffSettings)
-	backoff.RetryNotify(doHttpCall, &b, func(err error, wait time.Duration) {
-		log.Printf("Error: %s", err)
-	})
+// hostOf returns the host of rawURL, for keying Client.Breaker. If rawURL
+// cannot be parsed, rawURL itself is used as the key, so a malformed URL
+// still gets a (private, non-shared) breaker rather than panicking or
+// falling back to no breaker at all.
+func hostOf(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
 
-	switch {
-	case permError != nil:
-		return response, attempts, permError
-	case tempError != nil:
-		return response, attempts, tempError
-	default:
-		return response, attempts, nil
+// retryWithBreaker wraps RetryContext with client.Breaker, if set: while the
+// breaker is open for host, the call fails fast with BreakerOpenError
+// without invoking httpCall at all; otherwise RetryContext runs as normal.
+// Only a genuine exhausted-retry failure (the policy judged the error
+// retryable, but backoff ran out) is recorded against the breaker as a
+// failure; a permError or a RetryPolicy-declined-to-retry outcome (e.g. a
+// clean 4xx, or a non-idempotent method under ConservativeRetryPolicy) is
+// the caller's fault, not the host's, and is recorded as a success so it
+// cannot trip the breaker for otherwise-healthy traffic. If client.Breaker
+// is nil, this is exactly client.RetryContext.
+func (client *Client) retryWithBreaker(ctx context.Context, host string, httpCall func() (*http.Response, error, error)) (*http.Response, int, error) {
+	if client.Breaker == nil {
+		return client.RetryContext(ctx, httpCall)
+	}
+	if !client.Breaker.allow(host) {
+		return nil, 0, BreakerOpenError{Host: host}
 	}
+	resp, attempts, err, retryableFailure := client.retryContext(ctx, httpCall)
+	client.Breaker.record(host, !retryableFailure)
+	return resp, attempts, err
 }
 
 // Retry wrapper for http://golang.org/pkg/net/http/#Get where attempts is the number of http calls made (one plus number of retries).
-func (backOffSettings *ExponentialBackOff) Get(url string) (resp *http.Response, attempts int, err error) {
-	return backOffSettings.Retry(func() (*http.Response, error, error) {
-		resp, err := http.Get(url)
+func (client *Client) Get(url string) (resp *http.Response, attempts int, err error) {
+	return client.GetContext(context.Background(), url)
+}
+
+// GetContext is the context-aware variant of Get.
+func (client *Client) GetContext(ctx context.Context, url string) (resp *http.Response, attempts int, err error) {
+	return client.retryWithBreaker(ctx, hostOf(url), func() (*http.Response, error, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
 		// assume all errors should result in a retry
 		return resp, err, nil
 	})
 }
 
 // Retry wrapper for http://golang.org/pkg/net/http/#Head where attempts is the number of http calls made (one plus number of retries).
-func (backOffSettings *ExponentialBackOff) Head(url string) (resp *http.Response, attempts int, err error) {
-	return backOffSettings.Retry(func() (*http.Response, error, error) {
-		resp, err := http.Head(url)
+func (client *Client) Head(url string) (resp *http.Response, attempts int, err error) {
+	return client.HeadContext(context.Background(), url)
+}
+
+// HeadContext is the context-aware variant of Head.
+func (client *Client) HeadContext(ctx context.Context, url string) (resp *http.Response, attempts int, err error) {
+	return client.retryWithBreaker(ctx, hostOf(url), func() (*http.Response, error, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
 		// assume all errors should result in a retry
 		return resp, err, nil
 	})
 }
 
-// Retry wrapper for http://golang.org/pkg/net/http/#Post where attempts is the number of http calls made (one plus number of retries).
-func (backOffSettings *ExponentialBackOff) Post(url string, bodyType string, body io.Reader) (resp *http.Response, attempts int, err error) {
-	return backOffSettings.Retry(func() (*http.Response, error, error) {
-		resp, err := http.Post(url, bodyType, body)
+// Retry wrapper for http://golang.org/pkg/net/http/#Post where attempts is
+// the number of http calls made (one plus number of retries).
+//
+// body is passed to NewRequest, so it must be nil, []byte, string,
+// io.ReadSeeker, or a func() (io.ReadCloser, error); this lets Post rewind
+// the body on every retry, rather than silently resending an empty one.
+func (client *Client) Post(url string, bodyType string, body interface{}) (resp *http.Response, attempts int, err error) {
+	return client.PostContext(context.Background(), url, bodyType, body)
+}
+
+// PostContext is the context-aware variant of Post.
+func (client *Client) PostContext(ctx context.Context, url string, bodyType string, body interface{}) (resp *http.Response, attempts int, err error) {
+	req, err := NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", bodyType)
+	attempt := 0
+	return client.retryWithBreaker(ctx, hostOf(url), func() (*http.Response, error, error) {
+		if err := rewindRequest(req, attempt); err != nil {
+			return nil, nil, err
+		}
+		attempt++
+		resp, err := http.DefaultClient.Do(req)
 		// assume all errors should result in a retry
 		return resp, err, nil
 	})
 }
 
 // Retry wrapper for http://golang.org/pkg/net/http/#PostForm where attempts is the number of http calls made (one plus number of retries).
-func (backOffSettings *ExponentialBackOff) PostForm(url string, data url.Values) (resp *http.Response, attempts int, err error) {
-	return backOffSettings.Retry(func() (*http.Response, error, error) {
-		resp, err := http.PostForm(url, data)
+func (client *Client) PostForm(url string, data url.Values) (resp *http.Response, attempts int, err error) {
+	return client.PostFormContext(context.Background(), url, data)
+}
+
+// PostFormContext is the context-aware variant of PostForm.
+func (client *Client) PostFormContext(ctx context.Context, url string, data url.Values) (resp *http.Response, attempts int, err error) {
+	return client.retryWithBreaker(ctx, hostOf(url), func() (*http.Response, error, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(data.Encode()))
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := http.DefaultClient.Do(req)
 		// assume all errors should result in a retry
 		return resp, err, nil
 	})
 }
 
 // Retry wrapper for http://golang.org/pkg/net/http/#ReadResponse where attempts is the number of http calls made (one plus number of retries).
-func (backOffSettings *ExponentialBackOff) ReadResponse(r *bufio.Reader, req *http.Request) (resp *http.Response, attempts int, err error) {
-	return backOffSettings.Retry(func() (*http.Response, error, error) {
+func (client *Client) ReadResponse(r *bufio.Reader, req *http.Request) (resp *http.Response, attempts int, err error) {
+	return client.Retry(func() (*http.Response, error, error) {
 		resp, err := http.ReadResponse(r, req)
 		// assume all errors should result in a retry
 		return resp, err, nil
 	})
 }
 
-// Retry wrapper for http://golang.org/pkg/net/http/#Client.Do where attempts is the number of http calls made (one plus number of retries).
-func (backOffSettings *ExponentialBackOff) ClientDo(c *http.Client, req *http.Request) (resp *http.Response, attempts int, err error) {
-	return backOffSettings.Retry(func() (*http.Response, error, error) {
+// Retry wrapper for http://golang.org/pkg/net/http/#Client.Do where attempts
+// is the number of http calls made (one plus number of retries).
+//
+// If req has a body, it is rewound before each retry via req.GetBody; build
+// req with NewRequest to get a replayable body. A request with a
+// non-replayable body (req.GetBody is nil) fails on the first retry rather
+// than silently resending an empty body.
+func (client *Client) ClientDo(c *http.Client, req *http.Request) (resp *http.Response, attempts int, err error) {
+	return client.ClientDoContext(req.Context(), c, req)
+}
+
+// ClientDoContext is the context-aware variant of ClientDo.
+func (client *Client) ClientDoContext(ctx context.Context, c *http.Client, req *http.Request) (resp *http.Response, attempts int, err error) {
+	req = req.WithContext(ctx)
+	attempt := 0
+	return client.retryWithBreaker(ctx, req.URL.Host, func() (*http.Response, error, error) {
+		if err := rewindRequest(req, attempt); err != nil {
+			return nil, nil, err
+		}
+		attempt++
 		resp, err := c.Do(req)
 		// assume all errors should result in a retry
 		return resp, err, nil
@@ -185,46 +995,164 @@ func (backOffSettings *ExponentialBackOff) ClientDo(c *http.Client, req *http.Re
 }
 
 // Retry wrapper for http://golang.org/pkg/net/http/#Client.Get where attempts is the number of http calls made (one plus number of retries).
-func (backOffSettings *ExponentialBackOff) ClientGet(c *http.Client, url string) (resp *http.Response, attempts int, err error) {
-	return backOffSettings.Retry(func() (*http.Response, error, error) {
-		resp, err := c.Get(url)
+func (client *Client) ClientGet(c *http.Client, url string) (resp *http.Response, attempts int, err error) {
+	return client.ClientGetContext(context.Background(), c, url)
+}
+
+// ClientGetContext is the context-aware variant of ClientGet.
+func (client *Client) ClientGetContext(ctx context.Context, c *http.Client, url string) (resp *http.Response, attempts int, err error) {
+	return client.retryWithBreaker(ctx, hostOf(url), func() (*http.Response, error, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := c.Do(req)
 		// assume all errors should result in a retry
 		return resp, err, nil
 	})
 }
 
 // Retry wrapper for http://golang.org/pkg/net/http/#Client.Head where attempts is the number of http calls made (one plus number of retries).
-func (backOffSettings *ExponentialBackOff) ClientHead(c *http.Client, url string) (resp *http.Response, attempts int, err error) {
-	return backOffSettings.Retry(func() (*http.Response, error, error) {
-		resp, err := c.Head(url)
+func (client *Client) ClientHead(c *http.Client, url string) (resp *http.Response, attempts int, err error) {
+	return client.ClientHeadContext(context.Background(), c, url)
+}
+
+// ClientHeadContext is the context-aware variant of ClientHead.
+func (client *Client) ClientHeadContext(ctx context.Context, c *http.Client, url string) (resp *http.Response, attempts int, err error) {
+	return client.retryWithBreaker(ctx, hostOf(url), func() (*http.Response, error, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := c.Do(req)
 		// assume all errors should result in a retry
 		return resp, err, nil
 	})
 }
 
-// Retry wrapper for http://golang.org/pkg/net/http/#Client.Post where attempts is the number of http calls made (one plus number of retries).
-func (backOffSettings *ExponentialBackOff) ClientPost(c *http.Client, url string, bodyType string, body io.Reader) (resp *http.Response, attempts int, err error) {
-	return backOffSettings.Retry(func() (*http.Response, error, error) {
-		resp, err := c.Post(url, bodyType, body)
+// Retry wrapper for http://golang.org/pkg/net/http/#Client.Post where
+// attempts is the number of http calls made (one plus number of retries).
+//
+// body is passed to NewRequest; see Post.
+func (client *Client) ClientPost(c *http.Client, url string, bodyType string, body interface{}) (resp *http.Response, attempts int, err error) {
+	return client.ClientPostContext(context.Background(), c, url, bodyType, body)
+}
+
+// ClientPostContext is the context-aware variant of ClientPost.
+func (client *Client) ClientPostContext(ctx context.Context, c *http.Client, url string, bodyType string, body interface{}) (resp *http.Response, attempts int, err error) {
+	req, err := NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", bodyType)
+	attempt := 0
+	return client.retryWithBreaker(ctx, hostOf(url), func() (*http.Response, error, error) {
+		if err := rewindRequest(req, attempt); err != nil {
+			return nil, nil, err
+		}
+		attempt++
+		resp, err := c.Do(req)
 		// assume all errors should result in a retry
 		return resp, err, nil
 	})
 }
 
 // Retry wrapper for http://golang.org/pkg/net/http/#Client.PostForm where attempts is the number of http calls made (one plus number of retries).
-func (backOffSettings *ExponentialBackOff) ClientPostForm(c *http.Client, url string, data url.Values) (resp *http.Response, attempts int, err error) {
-	return backOffSettings.Retry(func() (*http.Response, error, error) {
-		resp, err := c.PostForm(url, data)
+func (client *Client) ClientPostForm(c *http.Client, url string, data url.Values) (resp *http.Response, attempts int, err error) {
+	return client.ClientPostFormContext(context.Background(), c, url, data)
+}
+
+// ClientPostFormContext is the context-aware variant of ClientPostForm.
+func (client *Client) ClientPostFormContext(ctx context.Context, c *http.Client, url string, data url.Values) (resp *http.Response, attempts int, err error) {
+	return client.retryWithBreaker(ctx, hostOf(url), func() (*http.Response, error, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(data.Encode()))
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := c.Do(req)
 		// assume all errors should result in a retry
 		return resp, err, nil
 	})
 }
 
-// Retry wrapper for http://golang.org/pkg/net/http/#Transport.RoundTrip where attempts is the number of http calls made (one plus number of retries).
-func (backOffSettings *ExponentialBackOff) RoundTrip(t *http.Transport, req *http.Request) (resp *http.Response, attempts int, err error) {
-	return backOffSettings.Retry(func() (*http.Response, error, error) {
+// Retry wrapper for http://golang.org/pkg/net/http/#Transport.RoundTrip
+// where attempts is the number of http calls made (one plus number of
+// retries). As with ClientDo, req's body is rewound before each retry via
+// req.GetBody; build req with NewRequest to get a replayable body.
+func (client *Client) RoundTrip(t *http.Transport, req *http.Request) (resp *http.Response, attempts int, err error) {
+	return client.RoundTripContext(req.Context(), t, req)
+}
+
+// RoundTripContext is the context-aware variant of RoundTrip.
+func (client *Client) RoundTripContext(ctx context.Context, t *http.Transport, req *http.Request) (resp *http.Response, attempts int, err error) {
+	req = req.WithContext(ctx)
+	attempt := 0
+	return client.retryWithBreaker(ctx, req.URL.Host, func() (*http.Response, error, error) {
+		if err := rewindRequest(req, attempt); err != nil {
+			return nil, nil, err
+		}
+		attempt++
 		resp, err := t.RoundTrip(req)
 		// assume all errors should result in a retry
 		return resp, err, nil
 	})
 }
+
+// backoffTransport is the http.RoundTripper returned by Client.Transport.
+type backoffTransport struct {
+	client *Client
+	base   http.RoundTripper
+	policy RetryPolicy
+}
+
+// RoundTrip implements http.RoundTripper by retrying base via RetryContext:
+// it rewinds req's body before each retry (build req with NewRequest, or
+// give it a GetBody, to make that possible), respects req.Context(), honors
+// Retry-After, and drains/closes intermediate responses. Per the
+// http.RoundTripper contract, it returns a nil response whenever it returns
+// a non-nil error.
+func (rt *backoffTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	client := rt.client
+	if rt.policy != nil {
+		clone := *client
+		clone.Policy = rt.policy
+		client = &clone
+	}
+
+	attempt := 0
+	resp, _, err := client.retryWithBreaker(req.Context(), req.URL.Host, func() (*http.Response, error, error) {
+		if rerr := rewindRequest(req, attempt); rerr != nil {
+			return nil, nil, rerr
+		}
+		attempt++
+		resp, rerr := rt.base.RoundTrip(req)
+		return resp, rerr, nil
+	})
+	if err != nil {
+		if resp != nil && resp.Body != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Transport returns an http.RoundTripper that wraps base with the same
+// retry logic as Retry: body rewinding, req.Context() cancellation,
+// Retry-After handling, and draining/closing intermediate responses. This
+// lets backoff be plugged into any code that only accepts an *http.Client
+// (SDKs, gRPC-gateway clients, resty, etc.) by setting it as that client's
+// Transport, without rewriting call sites.
+//
+// If base is nil, http.DefaultTransport is used. If policy is non-nil, it
+// overrides client.Policy for requests made through this transport only;
+// pass nil to use client.Policy (or DefaultRetryPolicy, if that is also
+// nil) as usual.
+func (client *Client) Transport(base http.RoundTripper, policy RetryPolicy) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &backoffTransport{client: client, base: base, policy: policy}
+}
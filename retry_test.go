@@ -3,13 +3,27 @@ package httpbackoff
 // See test_setup_test.go for test setup...
 
 import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// Check that the old type name ExponentialBackOff still works as a
+// declared variable type and as New()'s return type, for source
+// compatibility with code written against the pre-Client API.
+func TestExponentialBackOffAliasCompiles(t *testing.T) {
+	var c *ExponentialBackOff = New()
+	c.BackOffSettings.MaxInterval = time.Second
+	require.Equal(t, time.Second, c.BackOffSettings.MaxInterval)
+}
+
 // Stub server to send three 5xx failure status code responses
 // before finally sending a 200 resp. Make sure the retry
 // library retries until it gets the 200 resp.
@@ -39,6 +53,13 @@ func TestRetry5xx(t *testing.T) {
 // error is returned, even if htat was a 500.
 func TestRetry5xxAndFail(t *testing.T) {
 
+	// Restore InitialInterval once this test is done, so mutating it here
+	// to force exhaustion doesn't leak into later tests that share
+	// testClient.BackOffSettings and expect the TestMain defaults.
+	originalInitialInterval := testClient.BackOffSettings.InitialInterval
+	defer func() {
+		testClient.BackOffSettings.InitialInterval = originalInitialInterval
+	}()
 	testClient.BackOffSettings.InitialInterval = 10 * time.Millisecond
 
 	handler.QueueResponse(500)
@@ -106,6 +127,385 @@ func TestRetry429(t *testing.T) {
 	}
 }
 
+// Check that a POST built with NewRequest rewinds its body on every retry,
+// rather than sending an empty body once the first attempt has consumed it.
+func TestRetryPostRewindsBody(t *testing.T) {
+
+	handler.QueueResponse(503)
+	handler.QueueResponse(503)
+	handler.QueueResponse(200)
+
+	// defer clean up in case we have t.Fatalf calls
+	defer handler.ClearResponseQueue()
+
+	payload := "some=payload&that=must&be=resent"
+	req, err := NewRequest(http.MethodPost, "http://localhost:50849/TestRetryPostRewindsBody", payload)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, attempts, err := testClient.ClientDo(http.DefaultClient, req)
+
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, 3, attempts)
+	require.Equal(t, payload, handler.LastRequestBody)
+}
+
+// Check that Post/ClientPost still accept a plain, non-seekable io.Reader
+// (e.g. *bytes.Buffer), as they did before body was widened to interface{}:
+// bodyFactory must buffer it in memory so it can be replayed on retry.
+func TestRetryPostAcceptsPlainReader(t *testing.T) {
+
+	handler.QueueResponse(503)
+	handler.QueueResponse(200)
+
+	// defer clean up in case we have t.Fatalf calls
+	defer handler.ClearResponseQueue()
+
+	payload := "some=payload&that=must&be=resent"
+	resp, attempts, err := testClient.Post(
+		"http://localhost:50849/TestRetryPostAcceptsPlainReader",
+		"application/x-www-form-urlencoded",
+		bytes.NewBuffer([]byte(payload)),
+	)
+
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, 2, attempts)
+	require.Equal(t, payload, handler.LastRequestBody)
+}
+
+// Check that once a host's failure fraction reaches FailureThreshold, the
+// breaker opens and fails subsequent requests fast, without contacting the
+// server, until OpenDuration elapses.
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+
+	var transitions []State
+	client := &Client{
+		BackOffSettings: &backoff.ExponentialBackOff{
+			InitialInterval:     1 * time.Millisecond,
+			RandomizationFactor: 0.2,
+			Multiplier:          1.2,
+			MaxInterval:         5 * time.Millisecond,
+			MaxElapsedTime:      5 * time.Millisecond,
+			Clock:               backoff.SystemClock,
+		},
+		Breaker: &Breaker{
+			FailureThreshold: 0.5,
+			SamplingWindow:   time.Minute,
+			OpenDuration:     10 * time.Millisecond,
+			OnStateChange: func(host string, from, to State) {
+				transitions = append(transitions, to)
+			},
+		},
+	}
+
+	handler.QueueResponse(500)
+	handler.QueueResponse(500)
+	handler.QueueResponse(500)
+	handler.QueueResponse(500)
+	handler.QueueResponse(500)
+	defer handler.ClearResponseQueue()
+
+	// The first call exhausts its own retries against 500s and fails,
+	// which should be enough on its own to open the breaker given
+	// FailureThreshold 0.5.
+	_, _, err := client.Get("http://localhost:50849/TestCircuitBreaker")
+	require.Error(t, err)
+	require.Equal(t, []State{StateOpen}, transitions)
+
+	// While open, the request must fail fast with BreakerOpenError,
+	// without consuming a queued response.
+	before := len(handler.QueuedResponses)
+	_, attempts, err := client.Get("http://localhost:50849/TestCircuitBreaker")
+	require.Equal(t, BreakerOpenError{Host: "localhost:50849"}, err)
+	require.Equal(t, 0, attempts)
+	require.Equal(t, before, len(handler.QueuedResponses))
+
+	// After OpenDuration, a probe request is let through; let it succeed
+	// and confirm the breaker closes again.
+	time.Sleep(20 * time.Millisecond)
+	handler.QueueResponse(200)
+	resp, _, err := client.Get("http://localhost:50849/TestCircuitBreaker")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, []State{StateOpen, StateHalfOpen, StateClosed}, transitions)
+}
+
+// A host serving plain 404s is not "failing" in the circuit-breaker sense:
+// DefaultRetryPolicy never retries a 404, so the breaker should record each
+// one as a success, not a failure, and must not trip even after many of
+// them.
+func TestCircuitBreakerIgnoresNonRetryable4xx(t *testing.T) {
+
+	var transitions []State
+	client := &Client{
+		BackOffSettings: &backoff.ExponentialBackOff{
+			InitialInterval:     1 * time.Millisecond,
+			RandomizationFactor: 0.2,
+			Multiplier:          1.2,
+			MaxInterval:         5 * time.Millisecond,
+			MaxElapsedTime:      5 * time.Millisecond,
+			Clock:               backoff.SystemClock,
+		},
+		Breaker: &Breaker{
+			FailureThreshold: 0.5,
+			SamplingWindow:   time.Minute,
+			OpenDuration:     10 * time.Millisecond,
+			OnStateChange: func(host string, from, to State) {
+				transitions = append(transitions, to)
+			},
+		},
+	}
+
+	for i := 0; i < 5; i++ {
+		handler.QueueResponse(404)
+	}
+	defer handler.ClearResponseQueue()
+
+	for i := 0; i < 5; i++ {
+		resp, _, err := client.Get("http://localhost:50849/TestCircuitBreakerIgnoresNonRetryable4xx")
+		require.Error(t, err)
+		require.Equal(t, 404, resp.StatusCode)
+	}
+	require.Empty(t, transitions)
+}
+
+// Check that OnRetry and OnGiveUp fire with the expected counts, and that
+// Logger receives one ResponseLog per attempt, with a Dump only populated
+// because a Logger was registered.
+func TestRetryHooksAndLogger(t *testing.T) {
+
+	var onRetryCalls int
+	var giveUpAttempts int
+	var giveUpErr error
+	var logs []ResponseLog
+
+	client := &Client{
+		BackOffSettings: &backoff.ExponentialBackOff{
+			InitialInterval:     1 * time.Millisecond,
+			RandomizationFactor: 0.2,
+			Multiplier:          1.2,
+			MaxInterval:         5 * time.Millisecond,
+			MaxElapsedTime:      5 * time.Millisecond,
+			Clock:               backoff.SystemClock,
+		},
+		OnRetry: func(attempt int, wait time.Duration, req *http.Request, resp *http.Response, err error) {
+			onRetryCalls++
+		},
+		OnGiveUp: func(attempts int, lastErr error) {
+			giveUpAttempts = attempts
+			giveUpErr = lastErr
+		},
+		Logger: LoggerFunc(func(r ResponseLog) {
+			logs = append(logs, r)
+		}),
+	}
+
+	handler.QueueResponse(500)
+	handler.QueueResponse(500)
+	handler.QueueResponse(500)
+	handler.QueueResponse(500)
+	handler.QueueResponse(500)
+	defer handler.ClearResponseQueue()
+
+	resp, attempts, err := client.Get("http://localhost:50849/TestRetryHooksAndLogger")
+
+	require.Error(t, err)
+	require.Equal(t, 500, resp.StatusCode)
+	require.Equal(t, attempts, giveUpAttempts)
+	require.Equal(t, err, giveUpErr)
+	require.Equal(t, attempts-1, onRetryCalls)
+	require.Len(t, logs, attempts)
+	for _, l := range logs {
+		require.Equal(t, 500, l.StatusCode)
+		require.NotEmpty(t, l.Dump)
+	}
+}
+
+// Check that a registered Logger also receives a populated Dump for the
+// final, successful attempt, not just failing ones.
+func TestRetryLoggerDumpsSuccessfulResponse(t *testing.T) {
+
+	var logs []ResponseLog
+	client := &Client{
+		BackOffSettings: testClient.BackOffSettings,
+		Logger: LoggerFunc(func(r ResponseLog) {
+			logs = append(logs, r)
+		}),
+	}
+
+	handler.QueueResponse(200)
+	defer handler.ClearResponseQueue()
+
+	resp, attempts, err := client.Get("http://localhost:50849/TestRetryLoggerDumpsSuccessfulResponse")
+
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	require.Len(t, logs, attempts)
+	require.Equal(t, 200, logs[len(logs)-1].StatusCode)
+	require.NotEmpty(t, logs[len(logs)-1].Dump)
+}
+
+// Check that Client.Transport, wired into an *http.Client, transparently
+// retries a server that alternates 503 and 200 responses.
+func TestTransport(t *testing.T) {
+
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		BackOffSettings: &backoff.ExponentialBackOff{
+			InitialInterval:     1 * time.Millisecond,
+			RandomizationFactor: 0.2,
+			Multiplier:          1.2,
+			MaxInterval:         5 * time.Millisecond,
+			MaxElapsedTime:      time.Second,
+			Clock:               backoff.SystemClock,
+		},
+	}
+
+	httpClient := &http.Client{Transport: client.Transport(http.DefaultTransport, nil)}
+
+	resp, err := httpClient.Get(ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 3, calls)
+}
+
+// Check that cancelling ctx aborts an in-progress backoff wait promptly,
+// rather than waiting out the full exponential backoff schedule.
+func TestRetryContextCancelAbortsBackoffWait(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		BackOffSettings: &backoff.ExponentialBackOff{
+			InitialInterval:     time.Hour,
+			RandomizationFactor: 0,
+			Multiplier:          2,
+			MaxInterval:         time.Hour,
+			MaxElapsedTime:      0,
+			Clock:               backoff.SystemClock,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	started := time.Now()
+	_, _, err := client.GetContext(ctx, ts.URL)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(started), time.Second)
+}
+
+// Check both forms of the Retry-After header (delta-seconds and HTTP-date),
+// the negative delta-seconds guard, and the MaxInterval cap, by asserting
+// on the wait duration OnRetry is told to use.
+func TestRetryAfter(t *testing.T) {
+
+	for _, tc := range []struct {
+		name        string
+		header      func() string
+		wantWait    time.Duration
+		tolerance   time.Duration
+		wantApplied bool
+	}{
+		{name: "delta-seconds", header: func() string { return "1" }, wantWait: time.Second, tolerance: 500 * time.Millisecond, wantApplied: true},
+		{name: "negative delta-seconds ignored", header: func() string { return "-1" }, wantApplied: false},
+		// http.TimeFormat only has second-granularity, and ParseTime/Until
+		// both round, so allow a generous tolerance on the HTTP-date form.
+		{name: "http-date", header: func() string { return time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat) }, wantWait: 5 * time.Second, tolerance: 2 * time.Second, wantApplied: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls == 1 {
+					w.Header().Set("Retry-After", tc.header())
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer ts.Close()
+
+			var gotWait time.Duration
+			client := &Client{
+				BackOffSettings: &backoff.ExponentialBackOff{
+					InitialInterval:     1 * time.Millisecond,
+					RandomizationFactor: 0,
+					Multiplier:          2,
+					MaxInterval:         time.Minute,
+					MaxElapsedTime:      10 * time.Second,
+					Clock:               backoff.SystemClock,
+				},
+				OnRetry: func(attempt int, wait time.Duration, req *http.Request, resp *http.Response, err error) {
+					gotWait = wait
+				},
+			}
+
+			_, _, err := client.Get(ts.URL)
+			require.NoError(t, err)
+			if tc.wantApplied {
+				require.InDelta(t, tc.wantWait.Seconds(), gotWait.Seconds(), tc.tolerance.Seconds())
+			} else {
+				require.Less(t, gotWait, time.Second)
+			}
+		})
+	}
+}
+
+// Check that the MaxInterval cap is applied to a Retry-After value that
+// exceeds it.
+func TestRetryAfterCappedByMaxInterval(t *testing.T) {
+
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var gotWait time.Duration
+	client := &Client{
+		BackOffSettings: &backoff.ExponentialBackOff{
+			InitialInterval:     1 * time.Millisecond,
+			RandomizationFactor: 0,
+			Multiplier:          2,
+			MaxInterval:         5 * time.Millisecond,
+			MaxElapsedTime:      10 * time.Second,
+			Clock:               backoff.SystemClock,
+		},
+		OnRetry: func(attempt int, wait time.Duration, req *http.Request, resp *http.Response, err error) {
+			gotWait = wait
+		},
+	}
+
+	_, _, err := client.Get(ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Millisecond, gotWait)
+}
+
 // Test network failures get retried
 func TestNetworkFailure(t *testing.T) {
 
@@ -121,3 +521,89 @@ func TestNetworkFailure(t *testing.T) {
 		t.Errorf("Was expecting at least 4 retry attempts, but were only %v...\n", attempts)
 	}
 }
+
+// Check that ConservativeRetryPolicy never retries a non-idempotent method
+// (POST), even against a 503, while it still retries an idempotent one
+// (GET).
+func TestConservativeRetryPolicy(t *testing.T) {
+
+	postCalls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			postCalls++
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		BackOffSettings: testClient.BackOffSettings,
+		Policy:          ConservativeRetryPolicy,
+	}
+
+	_, attempts, err := client.Post(ts.URL, "text/plain", bytes.NewReader([]byte("payload")))
+	require.Error(t, err)
+	require.Equal(t, 1, attempts)
+	require.Equal(t, 1, postCalls)
+
+	_, attempts, err = client.Get(ts.URL)
+	require.Error(t, err)
+	require.Greater(t, attempts, 1)
+}
+
+// Check that AggressiveRetryPolicy retries a 409 on a POST carrying an
+// Idempotency-Key header (its special case), falls back to
+// DefaultRetryPolicy behavior otherwise, and still retries a plain 503.
+func TestAggressiveRetryPolicy(t *testing.T) {
+
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		BackOffSettings: testClient.BackOffSettings,
+		Policy:          AggressiveRetryPolicy,
+	}
+
+	req, err := NewRequest(http.MethodPost, ts.URL, []byte("payload"))
+	require.NoError(t, err)
+	req.Header.Set("Idempotency-Key", "some-key")
+
+	resp, attempts, err := client.ClientDo(http.DefaultClient, req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 3, attempts)
+}
+
+// Check that NewRetryPolicy retries the extra status codes it's given, on
+// top of DefaultRetryPolicy's usual 5xx/429 set.
+func TestNewRetryPolicyExtraStatusCodes(t *testing.T) {
+
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 2 {
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		BackOffSettings: testClient.BackOffSettings,
+		Policy:          NewRetryPolicy(http.StatusRequestTimeout),
+	}
+
+	resp, attempts, err := client.Get(ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 2, attempts)
+}
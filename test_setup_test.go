@@ -23,6 +23,7 @@ var (
 // Handler for stubbing http requests from auth API endpoint
 type MyHandler struct {
 	QueuedResponses []HTTPResponse
+	LastRequestBody string
 }
 
 type HTTPResponse struct {
@@ -32,6 +33,8 @@ type HTTPResponse struct {
 
 // Fake auth endpoint
 func (handler *MyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	handler.LastRequestBody = string(body)
 	if len(handler.QueuedResponses) == 0 {
 		return
 	}